@@ -3,8 +3,18 @@ package config
 import (
 	"fmt"
 	"os"
-	"regexp"
+	"strings"
 	"time"
+
+	"github.com/prometheus/prometheus/model/relabel"
+)
+
+// SinkType selects which backend a Scraper ships filtered samples to.
+type SinkType string
+
+const (
+	SinkGMP  SinkType = "gmp"
+	SinkOTLP SinkType = "otlp"
 )
 
 // Config holds all necessary configuration loaded from environment variables.
@@ -13,15 +23,29 @@ type Config struct {
 	Location       string
 	Cluster        string
 	CADVISORHost   string
+	CADVISORHosts  []string
 	ScrapeInterval time.Duration
-	FilterPattern  string
-	FilterRegex    *regexp.Regexp
+	ListenAddr     string
+
+	ConfigFile           string
+	MetricRelabelConfigs []*relabel.Config
+	KeepMetrics          []string
+
+	Sink         SinkType
+	OTLPEndpoint string
+	OTLPHeaders  map[string]string
+	OTLPInsecure bool
+
+	EnableK8sEnrichment bool
+	EnrichmentCacheTTL  time.Duration
 }
 
 const (
-	defaultCAdvisorHost   = "localhost:8080"
-	defaultScrapeInterval = 30 * time.Second
-	envVarName            = "SERVICE_PATTERN"
+	defaultCAdvisorHost       = "localhost:8080"
+	defaultScrapeInterval     = 30 * time.Second
+	defaultListenAddr         = ":9100"
+	defaultSink               = SinkGMP
+	defaultEnrichmentCacheTTL = 30 * time.Second
 )
 
 // LoadFromEnv reads configuration from environment variables.
@@ -32,26 +56,103 @@ func LoadFromEnv() (Config, error) {
 		Cluster:        os.Getenv("GCP_INSTANCE_NAME"),
 		CADVISORHost:   os.Getenv("CADVISOR_HOST"),
 		ScrapeInterval: defaultScrapeInterval,
+		ListenAddr:     os.Getenv("LISTEN_ADDR"),
 	}
 
 	if cfg.CADVISORHost == "" {
 		cfg.CADVISORHost = defaultCAdvisorHost
 	}
 
-	cfg.FilterPattern = os.Getenv(envVarName)
-	if cfg.FilterPattern == "" {
-		cfg.FilterPattern = `.*`
+	cfg.CADVISORHosts = parseCADVISORHosts(os.Getenv("CADVISOR_HOSTS"), cfg.CADVISORHost)
+
+	if cfg.ListenAddr == "" {
+		cfg.ListenAddr = defaultListenAddr
 	}
 
-	var err error
-	cfg.FilterRegex, err = regexp.Compile(cfg.FilterPattern)
-	if err != nil {
-		return cfg, fmt.Errorf("failed to compile regex pattern %q: %w", cfg.FilterPattern, err)
+	cfg.ConfigFile = os.Getenv("CONFIG_FILE")
+	if cfg.ConfigFile != "" {
+		relabelConfigs, keepMetrics, err := loadConfigFile(cfg.ConfigFile)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.MetricRelabelConfigs = relabelConfigs
+		cfg.KeepMetrics = keepMetrics
+	} else {
+		cfg.MetricRelabelConfigs = DefaultRelabelConfigs()
 	}
 
 	if cfg.ProjectID == "" || cfg.Location == "" || cfg.Cluster == "" {
 		return cfg, fmt.Errorf("GCP environment variables (GCP_PROJECT, GCP_ZONE, GCP_INSTANCE_NAME) must be set")
 	}
 
+	cfg.Sink = SinkType(os.Getenv("SINK_TYPE"))
+	if cfg.Sink == "" {
+		cfg.Sink = defaultSink
+	}
+	if cfg.Sink != SinkGMP && cfg.Sink != SinkOTLP {
+		return cfg, fmt.Errorf("invalid SINK_TYPE %q: must be %q or %q", cfg.Sink, SinkGMP, SinkOTLP)
+	}
+
+	cfg.OTLPEndpoint = os.Getenv("OTLP_ENDPOINT")
+	cfg.OTLPInsecure = os.Getenv("OTLP_INSECURE") == "true"
+	cfg.OTLPHeaders = parseOTLPHeaders(os.Getenv("OTLP_HEADERS"))
+
+	if cfg.Sink == SinkOTLP && cfg.OTLPEndpoint == "" {
+		return cfg, fmt.Errorf("OTLP_ENDPOINT must be set when SINK_TYPE=%s", SinkOTLP)
+	}
+
+	cfg.EnableK8sEnrichment = os.Getenv("ENABLE_K8S_ENRICHMENT") == "true"
+	cfg.EnrichmentCacheTTL = defaultEnrichmentCacheTTL
+	if raw := os.Getenv("K8S_ENRICHMENT_CACHE_TTL"); raw != "" {
+		ttl, err := time.ParseDuration(raw)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid K8S_ENRICHMENT_CACHE_TTL %q: %w", raw, err)
+		}
+		if ttl <= 0 {
+			return cfg, fmt.Errorf("K8S_ENRICHMENT_CACHE_TTL must be positive, got %q", raw)
+		}
+		cfg.EnrichmentCacheTTL = ttl
+	}
+
 	return cfg, nil
 }
+
+// parseCADVISORHosts splits a comma-separated CADVISOR_HOSTS value into its
+// targets, falling back to the single CADVISOR_HOST (or its default) when
+// CADVISOR_HOSTS isn't set, so existing single-target deployments keep working.
+func parseCADVISORHosts(raw, fallback string) []string {
+	if raw == "" {
+		return []string{fallback}
+	}
+
+	var hosts []string
+	for _, h := range strings.Split(raw, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		hosts = append(hosts, h)
+	}
+	if len(hosts) == 0 {
+		return []string{fallback}
+	}
+	return hosts
+}
+
+// parseOTLPHeaders parses a comma-separated list of key=value pairs, the
+// same format used by the standard OTEL_EXPORTER_OTLP_HEADERS env var.
+func parseOTLPHeaders(raw string) map[string]string {
+	if raw == "" {
+		return nil
+	}
+
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return headers
+}
@@ -4,8 +4,10 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/libops/cap/config"
+	"github.com/prometheus/prometheus/model/relabel"
 )
 
 // Helper function to reset environment variables after each test
@@ -14,7 +16,11 @@ func resetEnv() {
 	_ = os.Unsetenv("GCP_ZONE")
 	_ = os.Unsetenv("GCP_INSTANCE_NAME")
 	_ = os.Unsetenv("CADVISOR_HOST")
-	_ = os.Unsetenv("SERVICE_PATTERN")
+	_ = os.Unsetenv("CADVISOR_HOSTS")
+	_ = os.Unsetenv("LISTEN_ADDR")
+	_ = os.Unsetenv("CONFIG_FILE")
+	_ = os.Unsetenv("ENABLE_K8S_ENRICHMENT")
+	_ = os.Unsetenv("K8S_ENRICHMENT_CACHE_TTL")
 }
 
 func TestLoadFromEnv_Success(t *testing.T) {
@@ -22,7 +28,6 @@ func TestLoadFromEnv_Success(t *testing.T) {
 	_ = os.Setenv("GCP_PROJECT", "test-project")
 	_ = os.Setenv("GCP_ZONE", "us-central1-a")
 	_ = os.Setenv("GCP_INSTANCE_NAME", "test-cluster")
-	_ = os.Setenv("SERVICE_PATTERN", `(test-service|other-service)`)
 
 	cfg, err := config.LoadFromEnv()
 
@@ -36,40 +41,210 @@ func TestLoadFromEnv_Success(t *testing.T) {
 	if cfg.CADVISORHost != "localhost:8080" {
 		t.Errorf("Expected default CADVISORHost 'localhost:8080', got %s", cfg.CADVISORHost)
 	}
-	if cfg.FilterRegex.String() != `(test-service|other-service)` {
-		t.Errorf("Expected regex to match pattern, got %s", cfg.FilterRegex.String())
+	if len(cfg.CADVISORHosts) != 1 || cfg.CADVISORHosts[0] != "localhost:8080" {
+		t.Errorf("Expected CADVISORHosts to default to ['localhost:8080'], got %v", cfg.CADVISORHosts)
+	}
+	if cfg.ListenAddr != ":9100" {
+		t.Errorf("Expected default ListenAddr ':9100', got %s", cfg.ListenAddr)
+	}
+	if len(cfg.MetricRelabelConfigs) != len(config.DefaultRelabelConfigs()) {
+		t.Errorf("Expected default relabel configs when CONFIG_FILE is unset, got %d rules", len(cfg.MetricRelabelConfigs))
+	}
+	if cfg.EnableK8sEnrichment {
+		t.Error("Expected EnableK8sEnrichment to default to false")
+	}
+	if cfg.EnrichmentCacheTTL != 30*time.Second {
+		t.Errorf("Expected default EnrichmentCacheTTL of 30s, got %s", cfg.EnrichmentCacheTTL)
 	}
 }
 
-func TestLoadFromEnv_MissingGCPVars(t *testing.T) {
+func TestLoadFromEnv_K8sEnrichment(t *testing.T) {
 	resetEnv()
-	// Intentionally omit GCP_PROJECT
+	_ = os.Setenv("GCP_PROJECT", "p")
+	_ = os.Setenv("GCP_ZONE", "z")
+	_ = os.Setenv("GCP_INSTANCE_NAME", "c")
+	_ = os.Setenv("ENABLE_K8S_ENRICHMENT", "true")
+	_ = os.Setenv("K8S_ENRICHMENT_CACHE_TTL", "2m")
+
+	cfg, err := config.LoadFromEnv()
+
+	if err != nil {
+		t.Fatalf("LoadFromEnv failed unexpectedly: %v", err)
+	}
+	if !cfg.EnableK8sEnrichment {
+		t.Error("Expected EnableK8sEnrichment to be true")
+	}
+	if cfg.EnrichmentCacheTTL != 2*time.Minute {
+		t.Errorf("Expected EnrichmentCacheTTL of 2m, got %s", cfg.EnrichmentCacheTTL)
+	}
+}
+
+func TestLoadFromEnv_InvalidEnrichmentCacheTTL(t *testing.T) {
+	resetEnv()
+	_ = os.Setenv("GCP_PROJECT", "p")
+	_ = os.Setenv("GCP_ZONE", "z")
+	_ = os.Setenv("GCP_INSTANCE_NAME", "c")
+	_ = os.Setenv("K8S_ENRICHMENT_CACHE_TTL", "not-a-duration")
 
 	_, err := config.LoadFromEnv()
 
 	if err == nil {
-		t.Fatal("LoadFromEnv unexpectedly succeeded when required GCP vars were missing")
+		t.Fatal("LoadFromEnv unexpectedly succeeded with an invalid K8S_ENRICHMENT_CACHE_TTL")
 	}
-	expectedError := "GCP environment variables (GCP_PROJECT, GCP_ZONE, GCP_INSTANCE_NAME) must be set"
-	if !strings.Contains(err.Error(), expectedError) {
-		t.Errorf("Expected error containing '%s', got: %v", expectedError, err)
+	if !strings.Contains(err.Error(), "invalid K8S_ENRICHMENT_CACHE_TTL") {
+		t.Errorf("Expected error about K8S_ENRICHMENT_CACHE_TTL, got: %v", err)
 	}
 }
 
-func TestLoadFromEnv_InvalidRegex(t *testing.T) {
+func TestLoadFromEnv_NonPositiveEnrichmentCacheTTL(t *testing.T) {
 	resetEnv()
 	_ = os.Setenv("GCP_PROJECT", "p")
 	_ = os.Setenv("GCP_ZONE", "z")
 	_ = os.Setenv("GCP_INSTANCE_NAME", "c")
-	// Invalid regex: trailing backslash
-	_ = os.Setenv("SERVICE_PATTERN", `\`)
+	_ = os.Setenv("K8S_ENRICHMENT_CACHE_TTL", "0s")
 
 	_, err := config.LoadFromEnv()
 
 	if err == nil {
-		t.Fatal("LoadFromEnv unexpectedly succeeded with invalid regex")
+		t.Fatal("LoadFromEnv unexpectedly succeeded with a non-positive K8S_ENRICHMENT_CACHE_TTL")
+	}
+	if !strings.Contains(err.Error(), "must be positive") {
+		t.Errorf("Expected error about K8S_ENRICHMENT_CACHE_TTL being non-positive, got: %v", err)
 	}
-	expectedError := "failed to compile regex pattern"
+}
+
+func TestLoadFromEnv_ConfigFile(t *testing.T) {
+	resetEnv()
+	_ = os.Setenv("GCP_PROJECT", "p")
+	_ = os.Setenv("GCP_ZONE", "z")
+	_ = os.Setenv("GCP_INSTANCE_NAME", "c")
+
+	f, err := os.CreateTemp(t.TempDir(), "cap-config-*.yaml")
+	if err != nil {
+		t.Fatalf("Failed to create temp CONFIG_FILE: %v", err)
+	}
+	_, err = f.WriteString(`
+keep_metrics:
+  - container_cpu_usage_seconds_total
+metric_relabel_configs:
+  - source_labels: [name]
+    regex: 'libops-.*'
+    action: drop
+`)
+	if err != nil {
+		t.Fatalf("Failed to write temp CONFIG_FILE: %v", err)
+	}
+	_ = f.Close()
+
+	_ = os.Setenv("CONFIG_FILE", f.Name())
+
+	cfg, err := config.LoadFromEnv()
+
+	if err != nil {
+		t.Fatalf("LoadFromEnv failed unexpectedly: %v", err)
+	}
+
+	if len(cfg.KeepMetrics) != 1 || cfg.KeepMetrics[0] != "container_cpu_usage_seconds_total" {
+		t.Errorf("Expected KeepMetrics from CONFIG_FILE, got %v", cfg.KeepMetrics)
+	}
+	if len(cfg.MetricRelabelConfigs) != 1 {
+		t.Fatalf("Expected 1 relabel rule from CONFIG_FILE, got %d", len(cfg.MetricRelabelConfigs))
+	}
+}
+
+func TestLoadFromEnv_ConfigFileReplaceAction(t *testing.T) {
+	resetEnv()
+	_ = os.Setenv("GCP_PROJECT", "p")
+	_ = os.Setenv("GCP_ZONE", "z")
+	_ = os.Setenv("GCP_INSTANCE_NAME", "c")
+
+	f, err := os.CreateTemp(t.TempDir(), "cap-config-*.yaml")
+	if err != nil {
+		t.Fatalf("Failed to create temp CONFIG_FILE: %v", err)
+	}
+	_, err = f.WriteString(`
+metric_relabel_configs:
+  - source_labels: [name]
+    target_label: container
+    action: replace
+`)
+	if err != nil {
+		t.Fatalf("Failed to write temp CONFIG_FILE: %v", err)
+	}
+	_ = f.Close()
+
+	_ = os.Setenv("CONFIG_FILE", f.Name())
+
+	cfg, err := config.LoadFromEnv()
+
+	if err != nil {
+		t.Fatalf("LoadFromEnv failed unexpectedly: %v", err)
+	}
+
+	if len(cfg.MetricRelabelConfigs) != 1 {
+		t.Fatalf("Expected 1 relabel rule from CONFIG_FILE, got %d", len(cfg.MetricRelabelConfigs))
+	}
+
+	rule := cfg.MetricRelabelConfigs[0]
+	if rule.Action != relabel.Replace {
+		t.Errorf("Expected action 'replace', got %q", rule.Action)
+	}
+	if rule.TargetLabel != "container" {
+		t.Errorf("Expected target_label 'container', got %q", rule.TargetLabel)
+	}
+}
+
+func TestLoadFromEnv_MissingConfigFile(t *testing.T) {
+	resetEnv()
+	_ = os.Setenv("GCP_PROJECT", "p")
+	_ = os.Setenv("GCP_ZONE", "z")
+	_ = os.Setenv("GCP_INSTANCE_NAME", "c")
+	_ = os.Setenv("CONFIG_FILE", "/nonexistent/cap-config.yaml")
+
+	_, err := config.LoadFromEnv()
+
+	if err == nil {
+		t.Fatal("LoadFromEnv unexpectedly succeeded with a missing CONFIG_FILE")
+	}
+	if !strings.Contains(err.Error(), "failed to read CONFIG_FILE") {
+		t.Errorf("Expected error about reading CONFIG_FILE, got: %v", err)
+	}
+}
+
+func TestLoadFromEnv_MultipleCADVISORHosts(t *testing.T) {
+	resetEnv()
+	_ = os.Setenv("GCP_PROJECT", "p")
+	_ = os.Setenv("GCP_ZONE", "z")
+	_ = os.Setenv("GCP_INSTANCE_NAME", "c")
+	_ = os.Setenv("CADVISOR_HOSTS", "node-a:8080, node-b:8080 ,node-c:8080")
+
+	cfg, err := config.LoadFromEnv()
+
+	if err != nil {
+		t.Fatalf("LoadFromEnv failed unexpectedly: %v", err)
+	}
+
+	want := []string{"node-a:8080", "node-b:8080", "node-c:8080"}
+	if len(cfg.CADVISORHosts) != len(want) {
+		t.Fatalf("Expected %d hosts, got %d: %v", len(want), len(cfg.CADVISORHosts), cfg.CADVISORHosts)
+	}
+	for i, h := range want {
+		if cfg.CADVISORHosts[i] != h {
+			t.Errorf("Expected host %d to be %q, got %q", i, h, cfg.CADVISORHosts[i])
+		}
+	}
+}
+
+func TestLoadFromEnv_MissingGCPVars(t *testing.T) {
+	resetEnv()
+	// Intentionally omit GCP_PROJECT
+
+	_, err := config.LoadFromEnv()
+
+	if err == nil {
+		t.Fatal("LoadFromEnv unexpectedly succeeded when required GCP vars were missing")
+	}
+	expectedError := "GCP environment variables (GCP_PROJECT, GCP_ZONE, GCP_INSTANCE_NAME) must be set"
 	if !strings.Contains(err.Error(), expectedError) {
 		t.Errorf("Expected error containing '%s', got: %v", expectedError, err)
 	}
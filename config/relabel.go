@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	commonModel "github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/relabel"
+	"gopkg.in/yaml.v2"
+)
+
+// fileConfig mirrors the CONFIG_FILE schema: a Prometheus-style relabel
+// pipeline applied to every scraped series, plus an optional allowlist of
+// metric names to keep before relabeling runs.
+type fileConfig struct {
+	MetricRelabelConfigs []*relabel.Config `yaml:"metric_relabel_configs"`
+	KeepMetrics          []string          `yaml:"keep_metrics"`
+}
+
+// DefaultRelabelConfigs reproduces cap's original hard-coded carve-outs, so
+// CONFIG_FILE stays optional: drop libops-managed containers, drop cap's own
+// container, and drop the noisy container_tasks_state gauge.
+func DefaultRelabelConfigs() []*relabel.Config {
+	return []*relabel.Config{
+		{
+			SourceLabels: commonModel.LabelNames{"name"},
+			Regex:        relabel.MustNewRegexp(`libops-.*`),
+			Action:       relabel.Drop,
+		},
+		{
+			SourceLabels: commonModel.LabelNames{"name"},
+			Regex:        relabel.MustNewRegexp(`cap`),
+			Action:       relabel.Drop,
+		},
+		{
+			SourceLabels: commonModel.LabelNames{"__name__"},
+			Regex:        relabel.MustNewRegexp(`container_tasks_state`),
+			Action:       relabel.Drop,
+		},
+	}
+}
+
+// loadConfigFile reads and parses the relabel pipeline and keep_metrics
+// allowlist from a CONFIG_FILE.
+func loadConfigFile(path string) ([]*relabel.Config, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read CONFIG_FILE %q: %w", path, err)
+	}
+
+	var fc fileConfig
+	if err := yaml.Unmarshal(data, &fc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse CONFIG_FILE %q: %w", path, err)
+	}
+
+	return fc.MetricRelabelConfigs, fc.KeepMetrics, nil
+}
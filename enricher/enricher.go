@@ -0,0 +1,159 @@
+// Package enricher resolves cAdvisor's cgroup-path "id" label back to the
+// Kubernetes pod, namespace, and workload a container belongs to, so cap can
+// attach that context to exported metrics.
+package enricher
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	k8slabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	capConfig "github.com/libops/cap/config"
+)
+
+// PodMeta is the Kubernetes context resolved for a single container.
+type PodMeta struct {
+	Pod          string
+	Namespace    string
+	Workload     string
+	WorkloadKind string
+	Labels       map[string]string
+	Annotations  map[string]string
+}
+
+// Enricher watches Pods via a client-go informer and caches, per container
+// ID, the PodMeta to attach to its metrics. The cache is rebuilt from the
+// informer's local store every TTL rather than on every scrape, so
+// ProcessBody's lookups stay cheap.
+type Enricher struct {
+	factory   informers.SharedInformerFactory
+	podLister corelisters.PodLister
+	ttl       time.Duration
+
+	mu   sync.RWMutex
+	byID map[string]PodMeta
+}
+
+// New builds an Enricher from the in-cluster Kubernetes API server config.
+// cfg.EnrichmentCacheTTL controls both the informer resync period and how
+// often the lookup cache is rebuilt from the informer's store.
+func New(cfg capConfig.Config) (*Enricher, error) {
+	restCfg, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load in-cluster Kubernetes config: %w", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(restCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build Kubernetes client: %w", err)
+	}
+
+	factory := informers.NewSharedInformerFactory(clientset, cfg.EnrichmentCacheTTL)
+	podInformer := factory.Core().V1().Pods()
+
+	return &Enricher{
+		factory:   factory,
+		podLister: podInformer.Lister(),
+		ttl:       cfg.EnrichmentCacheTTL,
+		byID:      make(map[string]PodMeta),
+	}, nil
+}
+
+// Run starts the pod informer, waits for its initial sync, and then
+// rebuilds the lookup cache every TTL until ctx is cancelled.
+func (e *Enricher) Run(ctx context.Context) error {
+	e.factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), e.factory.Core().V1().Pods().Informer().HasSynced) {
+		return fmt.Errorf("failed to sync pod informer cache")
+	}
+
+	e.refresh()
+
+	ticker := time.NewTicker(e.ttl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			e.refresh()
+		}
+	}
+}
+
+// refresh rebuilds byID from the informer's current pod store.
+func (e *Enricher) refresh() {
+	pods, err := e.podLister.List(k8slabels.Everything())
+	if err != nil {
+		return
+	}
+
+	byID := make(map[string]PodMeta, len(pods))
+
+	for _, pod := range pods {
+		meta := PodMeta{
+			Pod:         pod.Name,
+			Namespace:   pod.Namespace,
+			Labels:      pod.Labels,
+			Annotations: pod.Annotations,
+		}
+		meta.Workload, meta.WorkloadKind = resolveWorkload(pod)
+
+		for _, cs := range pod.Status.ContainerStatuses {
+			byID[statusContainerID(cs.ContainerID)] = meta
+		}
+	}
+
+	e.mu.Lock()
+	e.byID = byID
+	e.mu.Unlock()
+}
+
+// Lookup resolves the PodMeta for a container given cAdvisor's "id" label,
+// a cgroup path (e.g. "/kubepods/burstable/pod<uid>/<container-id>" under
+// the cgroupfs driver, or ".../docker-<container-id>.scope" under systemd).
+func (e *Enricher) Lookup(cgroupID string) (PodMeta, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	meta, ok := e.byID[cgroupContainerID(cgroupID)]
+	return meta, ok
+}
+
+// cgroupContainerID extracts the bare container ID from cAdvisor's "id"
+// label, which is the final segment of the container's cgroup path, to
+// match against statusContainerID(ContainerStatus.ContainerID).
+func cgroupContainerID(cgroupID string) string {
+	seg := cgroupID
+	if idx := strings.LastIndex(cgroupID, "/"); idx >= 0 {
+		seg = cgroupID[idx+1:]
+	}
+	seg = strings.TrimSuffix(seg, ".scope")
+
+	for _, prefix := range []string{"docker-", "cri-containerd-", "crio-"} {
+		if rest, ok := strings.CutPrefix(seg, prefix); ok {
+			return rest
+		}
+	}
+	return seg
+}
+
+// statusContainerID strips the CRI runtime scheme (docker://, containerd://,
+// ...) from Kubernetes' ContainerStatus.ContainerID, to match
+// cgroupContainerID's output.
+func statusContainerID(s string) string {
+	if _, id, ok := strings.Cut(s, "://"); ok {
+		return id
+	}
+	return s
+}
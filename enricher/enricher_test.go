@@ -0,0 +1,33 @@
+package enricher
+
+import "testing"
+
+func TestCgroupContainerID(t *testing.T) {
+	cases := map[string]string{
+		"/kubepods/burstable/pod1/c1":                                          "c1",
+		"/kubepods.slice/kubepods-burstable.slice/docker-abc123.scope":         "abc123",
+		"/kubepods.slice/kubepods-burstable.slice/cri-containerd-def456.scope": "def456",
+		"/kubepods.slice/kubepods-burstable.slice/crio-789.scope":              "789",
+		"bare-id-no-path": "bare-id-no-path",
+	}
+
+	for in, want := range cases {
+		if got := cgroupContainerID(in); got != want {
+			t.Errorf("cgroupContainerID(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestStatusContainerID(t *testing.T) {
+	cases := map[string]string{
+		"containerd://abc123": "abc123",
+		"docker://def456":     "def456",
+		"abc123":              "abc123",
+	}
+
+	for in, want := range cases {
+		if got := statusContainerID(in); got != want {
+			t.Errorf("statusContainerID(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package enricher
+
+import (
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// podTemplateHashSuffix matches the pod-template-hash Kubernetes appends to
+// a Deployment-owned ReplicaSet's name. It's rendered from an FNV hash using
+// Kubernetes' own alphabet (digits plus lowercase consonants, no vowels, to
+// avoid spelling anything offensive).
+var podTemplateHashSuffix = regexp.MustCompile(`^[0-9bcdfghjklmnpqrstvwxz]{8,10}$`)
+
+// cronJobSuffix matches the suffix Kubernetes appends to a CronJob-owned
+// Job's name: a base-10 encoding of the scheduled run's Unix time.
+var cronJobSuffix = regexp.MustCompile(`^[0-9]{5,10}$`)
+
+// resolveWorkload walks a pod's owner reference to the workload that
+// created it, collapsing the generated ReplicaSet/Job hash suffix so pods
+// from the same Deployment/CronJob resolve to one workload name.
+func resolveWorkload(pod *corev1.Pod) (name, kind string) {
+	if len(pod.OwnerReferences) == 0 {
+		return pod.Name, "Pod"
+	}
+
+	owner := pod.OwnerReferences[0]
+	switch owner.Kind {
+	case "ReplicaSet":
+		if base, ok := trimGeneratedSuffix(owner.Name, podTemplateHashSuffix); ok {
+			return base, "Deployment"
+		}
+		return owner.Name, "ReplicaSet"
+	case "Job":
+		if base, ok := trimGeneratedSuffix(owner.Name, cronJobSuffix); ok {
+			return base, "CronJob"
+		}
+		return owner.Name, "Job"
+	default:
+		return owner.Name, owner.Kind
+	}
+}
+
+// trimGeneratedSuffix strips the trailing "-<suffix>" Kubernetes appends
+// when generating a ReplicaSet/Job name from its owning Deployment/CronJob,
+// but only when suffix actually looks machine-generated per suffixPattern —
+// otherwise an ordinary hyphenated standalone ReplicaSet/Job name (e.g.
+// "my-app" with no Deployment parent) would be misreported as a Deployment.
+func trimGeneratedSuffix(name string, suffixPattern *regexp.Regexp) (string, bool) {
+	idx := strings.LastIndex(name, "-")
+	if idx <= 0 {
+		return name, false
+	}
+
+	suffix := name[idx+1:]
+	if !suffixPattern.MatchString(suffix) {
+		return name, false
+	}
+
+	return name[:idx], true
+}
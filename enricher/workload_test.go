@@ -0,0 +1,85 @@
+package enricher
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResolveWorkload(t *testing.T) {
+	cases := []struct {
+		name        string
+		owners      []metav1.OwnerReference
+		wantName    string
+		wantKind    string
+		podFallback string
+	}{
+		{
+			name:        "no owner falls back to the pod itself",
+			owners:      nil,
+			podFallback: "standalone-pod",
+			wantName:    "standalone-pod",
+			wantKind:    "Pod",
+		},
+		{
+			name: "ReplicaSet owner resolves to its Deployment",
+			owners: []metav1.OwnerReference{
+				{Kind: "ReplicaSet", Name: "my-app-6c9c9f6b6f"},
+			},
+			wantName: "my-app",
+			wantKind: "Deployment",
+		},
+		{
+			name: "Job owner resolves to its CronJob",
+			owners: []metav1.OwnerReference{
+				{Kind: "Job", Name: "nightly-backup-28421400"},
+			},
+			wantName: "nightly-backup",
+			wantKind: "CronJob",
+		},
+		{
+			name: "DaemonSet owner is used as-is",
+			owners: []metav1.OwnerReference{
+				{Kind: "DaemonSet", Name: "node-exporter"},
+			},
+			wantName: "node-exporter",
+			wantKind: "DaemonSet",
+		},
+		{
+			name: "standalone ReplicaSet with an ordinary hyphenated name is not mistaken for a Deployment",
+			owners: []metav1.OwnerReference{
+				{Kind: "ReplicaSet", Name: "my-app"},
+			},
+			wantName: "my-app",
+			wantKind: "ReplicaSet",
+		},
+		{
+			name: "standalone Job with an ordinary hyphenated name is not mistaken for a CronJob",
+			owners: []metav1.OwnerReference{
+				{Kind: "Job", Name: "one-off-migration"},
+			},
+			wantName: "one-off-migration",
+			wantKind: "Job",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            tc.podFallback,
+					OwnerReferences: tc.owners,
+				},
+			}
+
+			gotName, gotKind := resolveWorkload(pod)
+			if gotName != tc.wantName {
+				t.Errorf("Expected workload name %q, got %q", tc.wantName, gotName)
+			}
+			if gotKind != tc.wantKind {
+				t.Errorf("Expected workload kind %q, got %q", tc.wantKind, gotKind)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Self-instrumentation for cap's own scrape loop, exposed on Cfg.ListenAddr
+// at /metrics, mirroring how Prometheus instruments its own scrape manager.
+var (
+	scrapeDurationSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "cap",
+		Name:      "scrape_duration_seconds",
+		Help:      "Time taken to fetch and process a single cAdvisor target.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"target"})
+
+	scrapeSamplesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cap",
+		Name:      "scrape_samples_total",
+		Help:      "Number of samples kept after filtering, per target.",
+	}, []string{"target"})
+
+	scrapeErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cap",
+		Name:      "scrape_errors_total",
+		Help:      "Number of failed scrape-and-export cycles, per target.",
+	}, []string{"target"})
+)
+
+// serveMetrics runs an HTTP server exposing /metrics on Cfg.ListenAddr until
+// ctx is cancelled.
+func (s *Scraper) serveMetrics(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	srv := &http.Server{
+		Addr:    s.Cfg.ListenAddr,
+		Handler: mux,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+		return srv.Close()
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	}
+}
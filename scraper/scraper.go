@@ -5,16 +5,18 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"math/rand"
 	"net/http"
-	"strings"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/export"
-	klog "github.com/go-kit/log"
 	capConfig "github.com/libops/cap/config" // Adjust import path
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/prometheus/config"
+	"github.com/libops/cap/enricher"
+	"github.com/prometheus/prometheus/model/histogram"
 	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
 	"github.com/prometheus/prometheus/model/textparse"
 	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/prometheus/prometheus/storage"
@@ -22,88 +24,170 @@ import (
 	"github.com/prometheus/prometheus/tsdb/record"
 )
 
+// maxConcurrentScrapes bounds how many targets cap will fetch and process at
+// once, regardless of how many CADVISOR_HOSTS are configured.
+const maxConcurrentScrapes = 8
+
 type Scraper struct {
-	Cfg         capConfig.Config
-	exporter    *export.Exporter
-	client      *http.Client
-	cAdvisorURL string
-	logger      *slog.Logger
-	labelsByRef map[storage.SeriesRef]labels.Labels
+	Cfg      capConfig.Config
+	sink     MetricSink
+	client   *http.Client
+	logger   *slog.Logger
+	enricher *enricher.Enricher
+
+	mu sync.RWMutex
+	// labelsByRef is keyed by target so each target's scrape fully replaces
+	// its own entry rather than accumulating every series ref ever seen for
+	// the life of the process.
+	labelsByRef map[string]map[storage.SeriesRef]labels.Labels
 }
 
 func NewTestScraper(cfg capConfig.Config, logger *slog.Logger) *Scraper {
 	return &Scraper{
 		Cfg:         cfg,
 		logger:      logger,
-		labelsByRef: make(map[storage.SeriesRef]labels.Labels),
+		labelsByRef: make(map[string]map[storage.SeriesRef]labels.Labels),
 	}
 }
 
 func NewScraper(cfg capConfig.Config, logger *slog.Logger, w io.Writer) (*Scraper, error) {
-	e, err := export.New(klog.NewJSONLogger(w), prometheus.NewRegistry(), export.ExporterOpts{
-		UserAgentEnv:     "libops-cap",
-		Endpoint:         "monitoring.googleapis.com:443",
-		Compression:      "none",
-		MetricTypePrefix: export.MetricTypePrefix,
-
-		Cluster:   cfg.Cluster,
-		Location:  cfg.Location,
-		ProjectID: cfg.ProjectID,
-	})
+	sink, err := newSink(cfg, w)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize Prometheus exporter: %w", err)
+		return nil, err
 	}
 
 	s := &Scraper{
 		Cfg:         cfg,
-		exporter:    e,
+		sink:        sink,
 		client:      &http.Client{Timeout: 10 * time.Second},
-		cAdvisorURL: fmt.Sprintf("http://%s/metrics", cfg.CADVISORHost),
 		logger:      logger,
-		labelsByRef: make(map[storage.SeriesRef]labels.Labels),
+		labelsByRef: make(map[string]map[storage.SeriesRef]labels.Labels),
 	}
+	s.sink.SetLabelsByIDFunc(s.GetLabelsByRef)
 
-	if err := s.exporter.ApplyConfig(&config.DefaultConfig); err != nil {
-		return nil, fmt.Errorf("failed to apply config to exporter: %w", err)
+	if cfg.EnableK8sEnrichment {
+		e, err := enricher.New(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize Kubernetes enricher: %w", err)
+		}
+		s.enricher = e
 	}
-	s.exporter.SetLabelsByIDFunc(s.GetLabelsByRef)
 
 	return s, nil
 }
 
+// newSink builds the MetricSink selected by cfg.Sink.
+func newSink(cfg capConfig.Config, w io.Writer) (MetricSink, error) {
+	switch cfg.Sink {
+	case capConfig.SinkOTLP:
+		return NewOTLPSink(context.Background(), cfg)
+	case capConfig.SinkGMP, "":
+		return NewGMPSink(cfg, w)
+	default:
+		return nil, fmt.Errorf("unknown sink type %q", cfg.Sink)
+	}
+}
+
 func (s *Scraper) GetLabelsByRef(ref storage.SeriesRef) labels.Labels {
-	return s.labelsByRef[ref]
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, byRef := range s.labelsByRef {
+		if lset, ok := byRef[ref]; ok {
+			return lset
+		}
+	}
+	return labels.EmptyLabels()
 }
 
+// Run scrapes every configured target concurrently (bounded by
+// maxConcurrentScrapes), each on its own jittered interval, until ctx is
+// cancelled. It also starts the sink's delivery loop and, if Cfg.ListenAddr
+// is set, a /metrics endpoint exposing cap's own scrape instrumentation.
 func (s *Scraper) Run(ctx context.Context) {
-	// Start the background exporter process
 	go func() {
-		if err := s.exporter.Run(ctx); err != nil {
-			s.logger.Error("Exporter failed", "err", err)
+		if err := s.sink.Run(ctx); err != nil {
+			s.logger.Error("Sink failed", "err", err)
 		}
 	}()
 
-	ticker := time.NewTicker(s.Cfg.ScrapeInterval)
-	defer ticker.Stop()
+	if s.Cfg.ListenAddr != "" {
+		go func() {
+			if err := s.serveMetrics(ctx); err != nil {
+				s.logger.Error("Metrics server failed", "err", err)
+			}
+		}()
+	}
+
+	if s.enricher != nil {
+		go func() {
+			if err := s.enricher.Run(ctx); err != nil {
+				s.logger.Error("Kubernetes enricher failed", "err", err)
+			}
+		}()
+	}
+
+	sem := make(chan struct{}, maxConcurrentScrapes)
+
+	var wg sync.WaitGroup
+	for _, target := range s.Cfg.CADVISORHosts {
+		wg.Add(1)
+		go func(target string) {
+			defer wg.Done()
+			s.runTarget(ctx, target, sem)
+		}(target)
+	}
+
+	wg.Wait()
+	s.logger.Info("Shutting down scraper", "reason", ctx.Err())
+}
+
+// runTarget repeatedly scrapes a single cAdvisor target on a jittered
+// interval until ctx is cancelled, acquiring sem before each scrape to
+// bound how many targets are fetched concurrently.
+func (s *Scraper) runTarget(ctx context.Context, target string, sem chan struct{}) {
+	timer := time.NewTimer(jitter(s.Cfg.ScrapeInterval))
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			s.logger.Info("Shutting down scraper", "reason", ctx.Err())
 			return
-		case <-ticker.C:
-			if err := s.scrapeAndExport(); err != nil {
-				s.logger.Error("Failed scrape and export iteration", "err", err)
+		case <-timer.C:
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			start := time.Now()
+			err := s.scrapeAndExport(target)
+			scrapeDurationSeconds.WithLabelValues(target).Observe(time.Since(start).Seconds())
+			if err != nil {
+				scrapeErrorsTotal.WithLabelValues(target).Inc()
+				s.logger.Error("Failed scrape and export iteration", "target", target, "err", err)
 			}
+
+			<-sem
+			timer.Reset(jitter(s.Cfg.ScrapeInterval))
 		}
 	}
 }
 
-// scrapeAndExport performs a single fetch, parse, filter, and export cycle.
-func (s *Scraper) scrapeAndExport() error {
-	resp, err := s.client.Get(s.cAdvisorURL)
+// jitter returns interval plus up to 10% random skew, spreading concurrent
+// targets out so they don't all hit the exporter and Cloud Monitoring API
+// at once.
+func jitter(interval time.Duration) time.Duration {
+	return interval + time.Duration(rand.Int63n(int64(interval)/10+1))
+}
+
+// scrapeAndExport performs a single fetch, parse, filter, and export cycle
+// for the given cAdvisor target.
+func (s *Scraper) scrapeAndExport(target string) error {
+	url := fmt.Sprintf("http://%s/metrics", target)
+
+	resp, err := s.client.Get(url)
 	if err != nil {
-		return fmt.Errorf("failed to fetch Prometheus metrics from %s: %w", s.cAdvisorURL, err)
+		return fmt.Errorf("failed to fetch Prometheus metrics from %s: %w", url, err)
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
@@ -120,32 +204,62 @@ func (s *Scraper) scrapeAndExport() error {
 		return fmt.Errorf("failed to read response body: %w", err)
 	}
 
-	batch, metadata, err := s.ProcessBody(bodyBytes)
+	contentType := resp.Header.Get("Content-Type")
+
+	batch, histBatch, metadata, err := s.ProcessBody(target, bodyBytes, contentType)
 	if err != nil {
 		return fmt.Errorf("failed to process scraped body: %w", err)
 	}
 
-	s.exporter.Export(func(metric string) (export.MetricMetadata, bool) {
+	err = s.sink.Export(target, func(metric string) (export.MetricMetadata, bool) {
 		m, ok := metadata[metric]
 		return m, ok
-	}, batch, nil)
+	}, batch, histBatch)
+	if err != nil {
+		return fmt.Errorf("failed to export batch: %w", err)
+	}
+
+	scrapeSamplesTotal.WithLabelValues(target).Add(float64(len(batch) + len(histBatch)))
 
 	return nil
 }
 
-func (s *Scraper) ProcessBody(bodyBytes []byte) ([]record.RefSample, map[string]export.MetricMetadata, error) {
-	tp, err := textparse.New(bodyBytes, "text/plain")
+// defaultContentType is assumed when cAdvisor doesn't set a Content-Type
+// header, matching the classic Prometheus text exposition format cap has
+// always supported.
+const defaultContentType = "text/plain"
+
+// ProcessBody parses a single scrape body, filters it down per Cfg, and
+// returns the resulting float samples and native histogram samples along
+// with their metric metadata. contentType should come from the scrape
+// response's Content-Type header; it may be "" to fall back to classic
+// Prometheus text, and selects the textparse parser (classic text,
+// OpenMetrics, or protobuf). Native histogram samples are produced only for
+// the protobuf exposition format; classic text and OpenMetrics bodies yield
+// none. target identifies which per-target slot of labelsByRef this scrape's
+// labels replace.
+func (s *Scraper) ProcessBody(target string, bodyBytes []byte, contentType string) ([]record.RefSample, []record.RefHistogramSample, map[string]export.MetricMetadata, error) {
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+
+	tp, err := textparse.New(bodyBytes, contentType)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to initialize text parser: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to initialize text parser: %w", err)
 	}
 
 	var (
-		currMeta export.MetricMetadata
-		batch    []record.RefSample
-		metadata = map[string]export.MetricMetadata{}
+		currMeta  export.MetricMetadata
+		batch     []record.RefSample
+		histBatch []record.RefHistogramSample
+		metadata  = map[string]export.MetricMetadata{}
 	)
 
-	s.labelsByRef = make(map[storage.SeriesRef]labels.Labels)
+	// Scraped locally and swapped into labelsByRef[target] at the end, so
+	// concurrent scrapes of different targets don't clobber each other and a
+	// target's stale series refs (from containers that no longer exist) are
+	// dropped instead of accumulating for the life of the process.
+	scrapedLabels := make(map[storage.SeriesRef]labels.Labels)
 
 	for {
 		et, err := tp.Next()
@@ -164,12 +278,37 @@ func (s *Scraper) ProcessBody(bodyBytes []byte) ([]record.RefSample, map[string]
 		case textparse.EntryUnit, textparse.EntryComment:
 			continue
 		case textparse.EntryHistogram:
-			// Handle as necessary or skip
-			s.logger.Warn("Skipping EntryHistogram (not implemented)", "metric", currMeta.Metric)
+			_, parsedTimestamp, h, fh := tp.Histogram()
+
+			t := timestamp.FromTime(time.Now())
+			if parsedTimestamp != nil {
+				t = *parsedTimestamp
+			}
+
+			lset := labels.New()
+			_ = tp.Metric(&lset)
+			lset = s.enrich(lset)
+			metadata[currMeta.Metric] = currMeta
+
+			count := histogramCount(h, fh)
+			relabeled, keep := s.filterAndRelabel(currMeta.Metric, lset, count > 0.0)
+			if keep {
+				ref := relabeled.Hash()
+				scrapedLabels[storage.SeriesRef(ref)] = relabeled
+				histBatch = append(histBatch, record.RefHistogramSample{
+					Ref: chunks.HeadSeriesRef(ref),
+					T:   t,
+					H:   h,
+					FH:  fh,
+				})
+			}
 			continue
 		default:
 		}
 
+		// Classic histogram buckets/sum/count and summary quantiles arrive
+		// here as ordinary series (e.g. foo_bucket, foo_sum, foo_count), so
+		// no special-casing is needed beyond the usual filtering below.
 		t := timestamp.FromTime(time.Now())
 		_, parsedTimestamp, val := tp.Series()
 		if parsedTimestamp != nil {
@@ -179,20 +318,13 @@ func (s *Scraper) ProcessBody(bodyBytes []byte) ([]record.RefSample, map[string]
 		lset := labels.New()
 		// Metric name is already stored in currMeta, we only need the labels populated in lset
 		_ = tp.Metric(&lset)
-		ref := lset.Hash()
-
+		lset = s.enrich(lset)
 		metadata[currMeta.Metric] = currMeta
-		s.labelsByRef[storage.SeriesRef(ref)] = lset
-
-		containerName := lset.Get("name")
 
-		isLibopsContainer := strings.HasPrefix(containerName, "libops-")
-		isTasksState := currMeta.Metric == "container_tasks_state"
-		isPositiveValue := val > 0.0
-		isCapContainer := containerName == "cap"
-		matchesRegex := s.Cfg.FilterRegex.MatchString(lset.String())
-
-		if !isLibopsContainer && !isTasksState && isPositiveValue && !isCapContainer && matchesRegex {
+		relabeled, keep := s.filterAndRelabel(currMeta.Metric, lset, val > 0.0)
+		if keep {
+			ref := relabeled.Hash()
+			scrapedLabels[storage.SeriesRef(ref)] = relabeled
 			batch = append(batch, record.RefSample{
 				Ref: chunks.HeadSeriesRef(ref),
 				V:   val,
@@ -200,5 +332,80 @@ func (s *Scraper) ProcessBody(bodyBytes []byte) ([]record.RefSample, map[string]
 			})
 		}
 	}
-	return batch, metadata, nil
+
+	s.mu.Lock()
+	s.labelsByRef[target] = scrapedLabels
+	s.mu.Unlock()
+
+	return batch, histBatch, metadata, nil
+}
+
+// enrich attaches Kubernetes pod/namespace/workload context to lset by
+// resolving cAdvisor's "id" (cgroup path) label through the enricher's
+// cache; the "name" label is not consulted. It's a no-op when Kubernetes
+// enrichment is disabled or the container can't be matched to a pod.
+func (s *Scraper) enrich(lset labels.Labels) labels.Labels {
+	if s.enricher == nil {
+		return lset
+	}
+
+	meta, ok := s.enricher.Lookup(lset.Get("id"))
+	if !ok {
+		return lset
+	}
+
+	b := labels.NewBuilder(lset)
+	b.Set("pod", meta.Pod)
+	b.Set("namespace", meta.Namespace)
+	b.Set("workload", meta.Workload)
+	b.Set("workload_kind", meta.WorkloadKind)
+	for k, v := range meta.Labels {
+		b.Set("pod_label_"+k, v)
+	}
+	for k, v := range meta.Annotations {
+		b.Set("pod_annotation_"+k, v)
+	}
+
+	return b.Labels()
+}
+
+// filterAndRelabel decides whether a series should be kept and, if so,
+// returns the label set to export: positive values only, then the
+// Cfg.KeepMetrics allowlist (if set), then Cfg.MetricRelabelConfigs — the
+// same keep|drop|replace|labeldrop|labelkeep pipeline Prometheus itself
+// uses for metric_relabel_configs.
+func (s *Scraper) filterAndRelabel(metricName string, lset labels.Labels, positive bool) (labels.Labels, bool) {
+	if !positive {
+		return lset, false
+	}
+
+	if len(s.Cfg.KeepMetrics) > 0 && !slices.Contains(s.Cfg.KeepMetrics, metricName) {
+		return lset, false
+	}
+
+	return relabel.Process(lset, s.Cfg.MetricRelabelConfigs...)
+}
+
+// histogramCount returns the total observation count of a native histogram,
+// whichever of the integer/float representations textparse handed back.
+func histogramCount(h *histogram.Histogram, fh *histogram.FloatHistogram) float64 {
+	if h != nil {
+		return float64(h.Count)
+	}
+	if fh != nil {
+		return fh.Count
+	}
+	return 0
+}
+
+// histogramSum returns the sum of all observations of a native histogram,
+// whichever of the integer/float representations textparse handed back.
+func histogramSum(h *histogram.Histogram, fh *histogram.FloatHistogram) float64 {
+	if h != nil {
+		return h.Sum
+	}
+	if fh != nil {
+		return fh.Sum
+	}
+	return 0
 }
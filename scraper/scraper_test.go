@@ -3,11 +3,12 @@ package scraper_test
 import (
 	"io"
 	"log/slog"
-	"regexp"
 	"testing"
 
 	"github.com/libops/cap/config"
 	"github.com/libops/cap/scraper"
+	commonModel "github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/relabel"
 	"github.com/prometheus/prometheus/storage"
 )
 
@@ -16,16 +17,14 @@ type MockScraper struct {
 	MockConfig       config.Config
 }
 
-func NewMockScraper(t *testing.T, pattern string) *MockScraper {
+func NewMockScraper(t *testing.T) *MockScraper {
 	cfg := config.Config{
-		ProjectID: "p",
-		Location:  "l",
-		Cluster:   "c",
+		ProjectID:            "p",
+		Location:             "l",
+		Cluster:              "c",
+		MetricRelabelConfigs: config.DefaultRelabelConfigs(),
 	}
 
-	// Compile the regex for the mock config
-	cfg.FilterRegex = regexp.MustCompile(pattern)
-
 	// Create a minimal real Scraper instance (must provide a valid io.Writer for klog)
 	s, err := scraper.NewScraper(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), io.Discard)
 	if err != nil {
@@ -53,14 +52,13 @@ container_cpu_usage_seconds_total{id="/kubepods/burstable/pod1/c3",name="other-a
 # TYPE container_tasks_state gauge
 container_tasks_state{state="running",name="my-app"} 1.0 1678886400000
 `
-	// The regex pattern for this test is set to match all strings (.*)
-	mock := NewMockScraper(t, ".*")
+	mock := NewMockScraper(t)
 
 	// Overwrite the embedded scraper's config with the mock config for this test
 	mock.Cfg = mock.MockConfig
 
 	// Call the new public method
-	batch, _, err := mock.ProcessBody([]byte(sampleBody))
+	batch, _, _, err := mock.ProcessBody("test-target", []byte(sampleBody), "")
 
 	if err != nil {
 		t.Fatalf("ProcessBody failed: %v", err)
@@ -95,11 +93,11 @@ func TestProcessBody_MetricParsing(t *testing.T) {
 # TYPE container_memory_working_set_bytes gauge
 container_memory_working_set_bytes{id="/",name="test-mem",namespace="test-ns"} 1000000.0
 `
-	mock := NewMockScraper(t, ".*")
+	mock := NewMockScraper(t)
 	mock.Cfg = mock.MockConfig
 
 	// Call the new public method
-	batch, metadata, err := mock.ProcessBody([]byte(sampleBody))
+	batch, _, metadata, err := mock.ProcessBody("test-target", []byte(sampleBody), "")
 
 	if err != nil {
 		t.Fatalf("ProcessBody failed: %v", err)
@@ -126,3 +124,69 @@ container_memory_working_set_bytes{id="/",name="test-mem",namespace="test-ns"} 1
 		t.Errorf("Expected label 'name'='test-mem', got '%s'", labelsByRef.Get("name"))
 	}
 }
+
+// TestProcessBody_NativeHistogram verifies that a native histogram series in
+// OpenMetrics exposition format is parsed into a RefHistogramSample rather
+// than silently skipped.
+func TestProcessBody_NativeHistogram(t *testing.T) {
+	sampleBody := `# TYPE container_fs_io_time_seconds histogram
+container_fs_io_time_seconds{id="/",name="my-app",namespace="default"} {count:5,sum:12.5,schema:3,zero_threshold:2.938735877055719e-39,zero_count:0} 1678886400.000
+# EOF
+`
+	mock := NewMockScraper(t)
+	mock.Cfg = mock.MockConfig
+
+	batch, histBatch, _, err := mock.ProcessBody("test-target", []byte(sampleBody), "application/openmetrics-text")
+
+	if err != nil {
+		t.Fatalf("ProcessBody failed: %v", err)
+	}
+
+	if len(batch) != 0 {
+		t.Fatalf("Expected 0 plain samples, got %d", len(batch))
+	}
+	if len(histBatch) != 1 {
+		t.Fatalf("Expected 1 histogram sample, got %d", len(histBatch))
+	}
+
+	labelsByRef := mock.GetLabelsByRef(storage.SeriesRef(histBatch[0].Ref))
+	if labelsByRef.Get("name") != "my-app" {
+		t.Errorf("Expected label 'name'='my-app', got '%s'", labelsByRef.Get("name"))
+	}
+}
+
+// TestProcessBody_ReplaceAction verifies that a CONFIG_FILE-style "replace"
+// relabel rule runs in ProcessBody, covering the rename-name-to-container
+// use case the rule-based relabel pipeline was built for.
+func TestProcessBody_ReplaceAction(t *testing.T) {
+	sampleBody := `
+# HELP container_cpu_usage_seconds_total Cumulative cpu time consumed in seconds.
+# TYPE container_cpu_usage_seconds_total counter
+container_cpu_usage_seconds_total{id="/",name="my-app",namespace="default"} 5.0 1678886400000
+`
+	mock := NewMockScraper(t)
+	mock.Cfg = mock.MockConfig
+	mock.Cfg.MetricRelabelConfigs = []*relabel.Config{
+		{
+			SourceLabels: commonModel.LabelNames{"name"},
+			Regex:        relabel.MustNewRegexp(`(.*)`),
+			Replacement:  "$1",
+			TargetLabel:  "container",
+			Action:       relabel.Replace,
+		},
+	}
+
+	batch, _, _, err := mock.ProcessBody("test-target", []byte(sampleBody), "")
+
+	if err != nil {
+		t.Fatalf("ProcessBody failed: %v", err)
+	}
+	if len(batch) != 1 {
+		t.Fatalf("Expected 1 metric sample, got %d", len(batch))
+	}
+
+	labelsByRef := mock.GetLabelsByRef(storage.SeriesRef(batch[0].Ref))
+	if labelsByRef.Get("container") != "my-app" {
+		t.Errorf("Expected 'replace' action to copy name into 'container', got '%s'", labelsByRef.Get("container"))
+	}
+}
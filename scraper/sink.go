@@ -0,0 +1,293 @@
+package scraper
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/export"
+	klog "github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	promconfig "github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/record"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	capConfig "github.com/libops/cap/config"
+)
+
+// MetricSink is the destination that receives the filtered cAdvisor samples
+// produced by Scraper.ProcessBody. GMPSink ships them straight to Cloud
+// Monitoring via the prometheus-engine exporter; OTLPSink re-encodes them as
+// OTLP metrics and ships them to a vendor-neutral collector instead.
+type MetricSink interface {
+	// Run starts any background delivery loop the sink needs and blocks
+	// until ctx is cancelled.
+	Run(ctx context.Context) error
+	// SetLabelsByIDFunc registers the lookup the sink uses to resolve a
+	// series ref back to its full label set at export time.
+	SetLabelsByIDFunc(f func(storage.SeriesRef) labels.Labels)
+	// Export hands a batch of float samples and, where present, native
+	// histogram samples off to the sink, resolving metric metadata as
+	// needed. target identifies the cAdvisor target this batch came from,
+	// so a sink can scope any per-scrape bookkeeping it keeps to it.
+	Export(target string, metadata func(metric string) (export.MetricMetadata, bool), series []record.RefSample, histograms []record.RefHistogramSample) error
+}
+
+// GMPSink exports samples to Cloud Monitoring via Google's
+// prometheus-engine exporter. It is the original, default sink.
+type GMPSink struct {
+	exporter    *export.Exporter
+	labelsByRef func(storage.SeriesRef) labels.Labels
+
+	mu sync.RWMutex
+	// syntheticLabels is keyed by target, same as Scraper.labelsByRef, so
+	// expandHistograms can replace a target's synthetic series each export
+	// instead of accumulating every one ever seen for the process lifetime.
+	syntheticLabels map[string]map[storage.SeriesRef]labels.Labels
+}
+
+// NewGMPSink builds a GMPSink configured for the given project/location/cluster.
+func NewGMPSink(cfg capConfig.Config, w io.Writer) (*GMPSink, error) {
+	e, err := export.New(klog.NewJSONLogger(w), prometheus.NewRegistry(), export.ExporterOpts{
+		UserAgentEnv:     "libops-cap",
+		Endpoint:         "monitoring.googleapis.com:443",
+		Compression:      "none",
+		MetricTypePrefix: export.MetricTypePrefix,
+
+		Cluster:   cfg.Cluster,
+		Location:  cfg.Location,
+		ProjectID: cfg.ProjectID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize Prometheus exporter: %w", err)
+	}
+
+	if err := e.ApplyConfig(&promconfig.DefaultConfig); err != nil {
+		return nil, fmt.Errorf("failed to apply config to exporter: %w", err)
+	}
+
+	return &GMPSink{exporter: e, syntheticLabels: make(map[string]map[storage.SeriesRef]labels.Labels)}, nil
+}
+
+func (g *GMPSink) Run(ctx context.Context) error {
+	return g.exporter.Run(ctx)
+}
+
+func (g *GMPSink) SetLabelsByIDFunc(f func(storage.SeriesRef) labels.Labels) {
+	g.labelsByRef = f
+	g.exporter.SetLabelsByIDFunc(g.resolveLabels)
+}
+
+// resolveLabels resolves a series ref to its labels, checking the synthetic
+// count/sum series expandHistograms creates before falling back to the
+// Scraper's own labelsByRef.
+func (g *GMPSink) resolveLabels(ref storage.SeriesRef) labels.Labels {
+	g.mu.RLock()
+	for _, byRef := range g.syntheticLabels {
+		if lset, ok := byRef[ref]; ok {
+			g.mu.RUnlock()
+			return lset
+		}
+	}
+	g.mu.RUnlock()
+	return g.labelsByRef(ref)
+}
+
+// Export hands samples to the prometheus-engine exporter, whose Export only
+// accepts plain float samples and an exemplar map — it has no support for
+// record.RefHistogramSample — so any histogram samples are first expanded
+// into classic _count/_sum series via expandHistograms. cap ships no
+// exemplars, so the third argument is always nil.
+func (g *GMPSink) Export(target string, metadata func(metric string) (export.MetricMetadata, bool), series []record.RefSample, histograms []record.RefHistogramSample) error {
+	series = append(series, g.expandHistograms(target, histograms)...)
+	g.exporter.Export(metadata, series, nil)
+	return nil
+}
+
+// expandHistograms converts native histogram samples into classic _count and
+// _sum series. Per-bucket detail isn't reconstructed: native histograms use
+// exponential schema buckets that don't correspond to any fixed set of
+// classic "le" thresholds, so only the aggregates survive the conversion.
+//
+// The resulting labels are stored under syntheticLabels[target], replacing
+// whatever that target produced last time, so series for containers that
+// have since disappeared don't accumulate for the life of the process.
+func (g *GMPSink) expandHistograms(target string, histograms []record.RefHistogramSample) []record.RefSample {
+	samples := make([]record.RefSample, 0, len(histograms)*2)
+	targetLabels := make(map[storage.SeriesRef]labels.Labels, len(histograms)*2)
+
+	for _, hs := range histograms {
+		lset := g.labelsByRef(storage.SeriesRef(hs.Ref))
+		name := lset.Get(labels.MetricName)
+		if name == "" {
+			continue
+		}
+
+		count, sum := histogramCount(hs.H, hs.FH), histogramSum(hs.H, hs.FH)
+
+		countLset := labels.NewBuilder(lset).Set(labels.MetricName, name+"_count").Labels()
+		sumLset := labels.NewBuilder(lset).Set(labels.MetricName, name+"_sum").Labels()
+
+		countRef := storage.SeriesRef(countLset.Hash())
+		sumRef := storage.SeriesRef(sumLset.Hash())
+		targetLabels[countRef] = countLset
+		targetLabels[sumRef] = sumLset
+
+		samples = append(samples,
+			record.RefSample{Ref: chunks.HeadSeriesRef(countRef), T: hs.T, V: count},
+			record.RefSample{Ref: chunks.HeadSeriesRef(sumRef), T: hs.T, V: sum},
+		)
+	}
+
+	g.mu.Lock()
+	g.syntheticLabels[target] = targetLabels
+	g.mu.Unlock()
+
+	return samples
+}
+
+// OTLPSink exports samples as OTLP metrics to a collector reachable over
+// gRPC or HTTP, as configured by Config.OTLPEndpoint.
+type OTLPSink struct {
+	exporter    metric.Exporter
+	cluster     string
+	location    string
+	labelsByRef func(storage.SeriesRef) labels.Labels
+}
+
+// NewOTLPSink builds an OTLPSink from Config.OTLPEndpoint/OTLPHeaders/OTLPInsecure.
+// OTLP_ENDPOINT determines the transport: a gRPC target (host:port) uses
+// OTLP/gRPC, anything starting with "http://" or "https://" uses OTLP/HTTP.
+func NewOTLPSink(ctx context.Context, cfg capConfig.Config) (*OTLPSink, error) {
+	exp, err := newOTLPExporter(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize OTLP exporter: %w", err)
+	}
+
+	return &OTLPSink{
+		exporter: exp,
+		cluster:  cfg.Cluster,
+		location: cfg.Location,
+	}, nil
+}
+
+func newOTLPExporter(ctx context.Context, cfg capConfig.Config) (metric.Exporter, error) {
+	if isHTTPEndpoint(cfg.OTLPEndpoint) {
+		opts := []otlpmetrichttp.Option{
+			otlpmetrichttp.WithEndpointURL(cfg.OTLPEndpoint),
+			otlpmetrichttp.WithHeaders(cfg.OTLPHeaders),
+		}
+		if cfg.OTLPInsecure {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		}
+		return otlpmetrichttp.New(ctx, opts...)
+	}
+
+	creds := credentials.NewTLS(&tls.Config{})
+	if cfg.OTLPInsecure {
+		creds = insecure.NewCredentials()
+	}
+
+	opts := []otlpmetricgrpc.Option{
+		otlpmetricgrpc.WithEndpoint(cfg.OTLPEndpoint),
+		otlpmetricgrpc.WithHeaders(cfg.OTLPHeaders),
+		otlpmetricgrpc.WithDialOption(grpc.WithTransportCredentials(creds)),
+	}
+	return otlpmetricgrpc.New(ctx, opts...)
+}
+
+func isHTTPEndpoint(endpoint string) bool {
+	return len(endpoint) >= 7 && (endpoint[:7] == "http://" || (len(endpoint) >= 8 && endpoint[:8] == "https://"))
+}
+
+// attributesFromLabels converts a Prometheus label set into OTLP attributes,
+// tagging each point with the cluster/location so samples from this sink
+// line up with the ones GMPSink would have produced.
+func (o *OTLPSink) attributesFromLabels(lset labels.Labels) attribute.Set {
+	kvs := make([]attribute.KeyValue, 0, lset.Len()+2)
+	lset.Range(func(l labels.Label) {
+		if l.Name == labels.MetricName {
+			return
+		}
+		kvs = append(kvs, attribute.String(l.Name, l.Value))
+	})
+	kvs = append(kvs,
+		attribute.String("cluster", o.cluster),
+		attribute.String("location", o.location),
+	)
+	return attribute.NewSet(kvs...)
+}
+
+func (o *OTLPSink) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return o.exporter.Shutdown(context.Background())
+}
+
+func (o *OTLPSink) SetLabelsByIDFunc(f func(storage.SeriesRef) labels.Labels) {
+	o.labelsByRef = f
+}
+
+// Export converts the float samples to OTLP gauge points. Native histogram
+// samples are ignored and not counted; unlike GMPSink, which exports their
+// _count/_sum, this sink exports nothing for them.
+func (o *OTLPSink) Export(_ string, metadata func(metric string) (export.MetricMetadata, bool), series []record.RefSample, histograms []record.RefHistogramSample) error {
+	if len(series) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	scopeMetrics := make(map[string]metricdata.Metrics, len(series))
+
+	for _, sample := range series {
+		lset := o.labelsByRef(storage.SeriesRef(sample.Ref))
+		metricName := lset.Get(labels.MetricName)
+
+		m, ok := scopeMetrics[metricName]
+		if !ok {
+			meta, _ := metadata(metricName)
+			m = metricdata.Metrics{
+				Name:        metricName,
+				Description: meta.Help,
+				Data: metricdata.Gauge[float64]{
+					DataPoints: nil,
+				},
+			}
+		}
+
+		gauge := m.Data.(metricdata.Gauge[float64])
+		gauge.DataPoints = append(gauge.DataPoints, metricdata.DataPoint[float64]{
+			Attributes: o.attributesFromLabels(lset),
+			Time:       now,
+			Value:      sample.V,
+		})
+		m.Data = gauge
+		scopeMetrics[metricName] = m
+	}
+
+	rm := &metricdata.ResourceMetrics{
+		ScopeMetrics: []metricdata.ScopeMetrics{
+			{Metrics: make([]metricdata.Metrics, 0, len(scopeMetrics))},
+		},
+	}
+	for _, m := range scopeMetrics {
+		rm.ScopeMetrics[0].Metrics = append(rm.ScopeMetrics[0].Metrics, m)
+	}
+
+	if err := o.exporter.Export(context.Background(), rm); err != nil {
+		return fmt.Errorf("failed to export batch to OTLP endpoint: %w", err)
+	}
+	return nil
+}
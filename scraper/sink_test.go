@@ -0,0 +1,169 @@
+package scraper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/prometheus-engine/pkg/export"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/record"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestIsHTTPEndpoint(t *testing.T) {
+	cases := map[string]bool{
+		"http://collector:4318":    true,
+		"https://collector:4318":   true,
+		"collector:4317":           false,
+		"":                         false,
+		"httpcollector.local:4317": false,
+	}
+
+	for endpoint, want := range cases {
+		if got := isHTTPEndpoint(endpoint); got != want {
+			t.Errorf("isHTTPEndpoint(%q) = %v, want %v", endpoint, got, want)
+		}
+	}
+}
+
+// TestGMPSinkExpandHistograms verifies that a native histogram sample is
+// expanded into classic _count/_sum series, and that resolveLabels can look
+// the resulting synthetic refs back up.
+func TestGMPSinkExpandHistograms(t *testing.T) {
+	lset := labels.FromStrings(labels.MetricName, "container_fs_io_time_seconds", "name", "my-app")
+	ref := storage.SeriesRef(lset.Hash())
+
+	g := &GMPSink{
+		labelsByRef:     func(storage.SeriesRef) labels.Labels { return lset },
+		syntheticLabels: make(map[string]map[storage.SeriesRef]labels.Labels),
+	}
+
+	histograms := []record.RefHistogramSample{
+		{
+			Ref: chunks.HeadSeriesRef(ref),
+			T:   1678886400000,
+			H:   &histogram.Histogram{Count: 5, Sum: 12.5},
+		},
+	}
+
+	samples := g.expandHistograms("target-a", histograms)
+
+	if len(samples) != 2 {
+		t.Fatalf("Expected 2 samples (_count and _sum), got %d", len(samples))
+	}
+
+	gotCount, gotSum := samples[0].V, samples[1].V
+	if gotCount != 5 {
+		t.Errorf("Expected _count value 5, got %v", gotCount)
+	}
+	if gotSum != 12.5 {
+		t.Errorf("Expected _sum value 12.5, got %v", gotSum)
+	}
+
+	countLabels := g.resolveLabels(storage.SeriesRef(samples[0].Ref))
+	if countLabels.Get(labels.MetricName) != "container_fs_io_time_seconds_count" {
+		t.Errorf("Expected resolved _count series name, got %q", countLabels.Get(labels.MetricName))
+	}
+	sumLabels := g.resolveLabels(storage.SeriesRef(samples[1].Ref))
+	if sumLabels.Get(labels.MetricName) != "container_fs_io_time_seconds_sum" {
+		t.Errorf("Expected resolved _sum series name, got %q", sumLabels.Get(labels.MetricName))
+	}
+}
+
+// TestGMPSinkExpandHistogramsReplacesStaleTarget verifies that re-expanding
+// for a target drops series from that target's previous call instead of
+// accumulating them, which is what bounds syntheticLabels' memory growth.
+func TestGMPSinkExpandHistogramsReplacesStaleTarget(t *testing.T) {
+	staleLset := labels.FromStrings(labels.MetricName, "stale_metric")
+	staleRef := storage.SeriesRef(staleLset.Hash())
+
+	g := &GMPSink{
+		labelsByRef: func(storage.SeriesRef) labels.Labels { return labels.EmptyLabels() },
+		syntheticLabels: map[string]map[storage.SeriesRef]labels.Labels{
+			"target-a": {staleRef: staleLset},
+		},
+	}
+
+	g.expandHistograms("target-a", nil)
+
+	if name := g.resolveLabels(staleRef).Get(labels.MetricName); name != "" {
+		t.Errorf("Expected stale synthetic series for target-a to be dropped after re-expanding with no histograms, still resolved to %q", name)
+	}
+}
+
+// fakeExporter is a minimal metric.Exporter that records the last
+// ResourceMetrics it was given, so OTLPSink.Export can be tested without a
+// real OTLP collector.
+type fakeExporter struct {
+	metric.Exporter
+	got *metricdata.ResourceMetrics
+}
+
+func (f *fakeExporter) Export(_ context.Context, rm *metricdata.ResourceMetrics) error {
+	f.got = rm
+	return nil
+}
+
+func TestOTLPSinkExport(t *testing.T) {
+	lset := labels.FromStrings(labels.MetricName, "container_memory_working_set_bytes", "name", "my-app")
+	ref := storage.SeriesRef(lset.Hash())
+
+	exp := &fakeExporter{}
+	o := &OTLPSink{
+		exporter:    exp,
+		cluster:     "test-cluster",
+		location:    "us-central1",
+		labelsByRef: func(storage.SeriesRef) labels.Labels { return lset },
+	}
+
+	series := []record.RefSample{
+		{Ref: chunks.HeadSeriesRef(ref), V: 1000000.0},
+	}
+
+	err := o.Export("target-a", func(metric string) (export.MetricMetadata, bool) {
+		return export.MetricMetadata{Metric: metric, Help: "help text"}, true
+	}, series, nil)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	if exp.got == nil {
+		t.Fatal("Expected the fake exporter to receive ResourceMetrics")
+	}
+	if len(exp.got.ScopeMetrics) != 1 || len(exp.got.ScopeMetrics[0].Metrics) != 1 {
+		t.Fatalf("Expected exactly 1 metric, got %+v", exp.got.ScopeMetrics)
+	}
+
+	m := exp.got.ScopeMetrics[0].Metrics[0]
+	if m.Name != "container_memory_working_set_bytes" {
+		t.Errorf("Expected metric name 'container_memory_working_set_bytes', got %q", m.Name)
+	}
+	if m.Description != "help text" {
+		t.Errorf("Expected metric description 'help text', got %q", m.Description)
+	}
+
+	gauge, ok := m.Data.(metricdata.Gauge[float64])
+	if !ok {
+		t.Fatalf("Expected metric data to be a Gauge[float64], got %T", m.Data)
+	}
+	if len(gauge.DataPoints) != 1 || gauge.DataPoints[0].Value != 1000000.0 {
+		t.Errorf("Expected a single data point with value 1000000.0, got %+v", gauge.DataPoints)
+	}
+}
+
+func TestOTLPSinkExportEmptySeries(t *testing.T) {
+	exp := &fakeExporter{}
+	o := &OTLPSink{exporter: exp}
+
+	err := o.Export("target-a", func(string) (export.MetricMetadata, bool) { return export.MetricMetadata{}, false }, nil, nil)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if exp.got != nil {
+		t.Error("Expected no export call for an empty series batch")
+	}
+}